@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// CompatibilityMode selects how strictly a plugin's required dependency
+// version is checked against the host's own, for any dependency not covered
+// by a more specific DependencyPolicy in the plugin manifest.
+type CompatibilityMode int
+
+const (
+	// Strict requires the host and plugin to share the exact same version.
+	Strict CompatibilityMode = iota
+	// MinimumVersion accepts any host version that is semver >= the
+	// plugin's required version, regardless of major version.
+	MinimumVersion
+	// SameMajor is Go's own Minimum Version Selection rule: the host
+	// version must be semver >= the plugin's required version *and* share
+	// the same semver major.
+	SameMajor
+	// WarnOnly logs a mismatch but never blocks loading.
+	WarnOnly
+)
+
+// DependencyMismatch describes a single dependency whose host and
+// plugin-required versions failed the selected CompatibilityMode check.
+type DependencyMismatch struct {
+	Path   string
+	Have   string
+	Want   string
+	Reason string
+}
+
+// DependencyMismatchError lists every dependency that failed its
+// compatibility check, so callers can decide policy instead of parsing log
+// lines.
+type DependencyMismatchError struct {
+	Mismatches []DependencyMismatch
+}
+
+func (e *DependencyMismatchError) Error() string {
+	reasons := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		reasons[i] = fmt.Sprintf("%s (have=%s want=%s): %s", m.Path, m.Have, m.Want, m.Reason)
+	}
+	return fmt.Sprintf("dependency compatibility check failed for %d module(s): %s", len(e.Mismatches), strings.Join(reasons, "; "))
+}
+
+// checkVersionCompatibility reports whether have satisfies want under mode,
+// returning nil when it does and a descriptive error otherwise. Versions
+// that aren't valid semver (e.g. pseudo-versions missing a "v" prefix) fall
+// back to an exact-equality comparison, since semver.Compare's ordering is
+// undefined for them.
+func checkVersionCompatibility(have, want string, mode CompatibilityMode) error {
+	if mode == WarnOnly {
+		return nil
+	}
+
+	if have == want {
+		return nil
+	}
+
+	if mode == Strict {
+		return fmt.Errorf("versions differ: have=%s want=%s", have, want)
+	}
+
+	if !semver.IsValid(have) || !semver.IsValid(want) {
+		return fmt.Errorf("versions differ and are not comparable as semver: have=%s want=%s", have, want)
+	}
+
+	if mode == SameMajor && semver.Major(have) != semver.Major(want) {
+		return fmt.Errorf("major version mismatch: have=%s want=%s", have, want)
+	}
+
+	if semver.Compare(have, want) < 0 {
+		return fmt.Errorf("host version is older than required: have=%s want=%s", have, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckVersionCompatibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		have    string
+		want    string
+		mode    CompatibilityMode
+		wantErr bool
+	}{
+		{"warn-only never errors", "v1.0.0", "v2.0.0", WarnOnly, false},
+		{"strict equal passes", "v1.2.3", "v1.2.3", Strict, false},
+		{"strict differing fails", "v1.2.3", "v1.2.4", Strict, true},
+		{"minimum-version host newer passes", "v1.5.0", "v1.2.0", MinimumVersion, false},
+		{"minimum-version host older fails", "v1.1.0", "v1.2.0", MinimumVersion, true},
+		{"minimum-version ignores major", "v2.0.0", "v1.2.0", MinimumVersion, false},
+		{"same-major host newer passes", "v1.5.0", "v1.2.0", SameMajor, false},
+		{"same-major host older fails", "v1.1.0", "v1.2.0", SameMajor, true},
+		{"same-major major mismatch fails", "v2.0.0", "v1.2.0", SameMajor, true},
+		{"equal non-semver versions pass trivially", "abcd1234", "abcd1234", SameMajor, false},
+		{"differing non-semver versions are not comparable", "some-sha", "other-sha", SameMajor, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVersionCompatibility(tt.have, tt.want, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkVersionCompatibility(%q, %q, %v) error = %v, wantErr %v", tt.have, tt.want, tt.mode, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDependencyMismatchErrorListsEveryModule(t *testing.T) {
+	err := &DependencyMismatchError{
+		Mismatches: []DependencyMismatch{
+			{Path: "example.com/a", Have: "v1.0.0", Want: "v2.0.0", Reason: "major version mismatch"},
+			{Path: "example.com/b", Have: "v1.0.0", Want: "v1.5.0", Reason: "host version is older than required"},
+		},
+	}
+
+	msg := err.Error()
+	for _, want := range []string{"example.com/a", "example.com/b", "2"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("DependencyMismatchError.Error() = %q, missing %q", msg, want)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"unsafe"
 
 	"github.com/pkujhd/goloader"
@@ -25,22 +31,65 @@ func main() {
 		return
 	}
 
-	implementationWrapper, err := NewImplementationWrapper(os.Args[1])
+	trustedKeys, err := trustedKeysFromEnv()
+	if err != nil {
+		fmt.Printf("failed to load trusted signing keys: %s\n", err)
+		return
+	}
+
+	supervisor, err := NewPluginSupervisor(os.Args[1], SameMajor, trustedKeys)
 	if err != nil {
 		fmt.Printf("failed to load implementation: %s\n", err)
 		return
 	}
+	defer supervisor.Close()
 
-	stuff := "default test stuff"
+	// a one-off argument keeps the previous script-friendly behaviour; with
+	// none given we stay up so the supervisor's hot-reload can actually do
+	// something while the process is running
 	if len(os.Args) > 2 {
-		stuff = os.Args[2]
+		processAndPrint(supervisor.Wrapper(), os.Args[2])
+		return
 	}
 
-	processedStuff, err := implementationWrapper.ProcessStuff(stuff)
+	runLoop(supervisor)
+}
+
+// runLoop processes stdin line by line against whichever generation the
+// supervisor currently has active, so a hot-reload swapped in mid-run is
+// picked up by the very next line. It returns on EOF or SIGINT/SIGTERM.
+func runLoop(supervisor *PluginSupervisor) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case <-sigCh:
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			processAndPrint(supervisor.Wrapper(), line)
+		}
+	}
+}
+
+func processAndPrint(wrapper *ImplementationWrapper, stuff string) {
+	processedStuff, err := wrapper.ProcessStuff(stuff)
 	if err != nil {
 		fmt.Printf("failed to process stuff: %s\n", err)
+		return
 	}
-
 	fmt.Println(processedStuff)
 }
 
@@ -48,12 +97,64 @@ type Interface interface {
 	ProcessStuff(string) (string, error)
 }
 
-type ImplementationWrapper struct {
+// generation bundles a single loaded CodeModule with the implementation
+// resolved from it and the bookkeeping needed to unload it safely: refCount
+// tracks in-flight ProcessStuff calls, retiring marks a generation that has
+// already been swapped out and should be unloaded as soon as refCount drops
+// to zero, and unloaded guards that unload itself so release and retire can
+// never both win the zero-refCount check and call it twice. unload defaults
+// to module.Unload but is stored separately so the refcount state machine
+// can be exercised in tests with a fake generation, without a real
+// dynamically-linked module behind it.
+type generation struct {
 	module         *goloader.CodeModule
 	implementation Interface
+	refCount       int64
+	retiring       int32
+	unloaded       int32
+	unload         func()
+}
+
+// unloadOnce calls gen.unload the first time release or retire observes
+// refCount has dropped to zero on a retired generation, and never again: a
+// second call would, for a real module, munmap memory a newer generation
+// may already have reused.
+func (gen *generation) unloadOnce() {
+	if atomic.CompareAndSwapInt32(&gen.unloaded, 0, 1) {
+		gen.unload()
+	}
+}
+
+// ImplementationWrapper holds the currently active generation behind an
+// atomic.Pointer so it can be swapped out from under in-flight ProcessStuff
+// calls without those calls ever seeing a half-unloaded module.
+type ImplementationWrapper struct {
+	current atomic.Pointer[generation]
 }
 
-func NewImplementationWrapper(dir string) (*ImplementationWrapper, error) {
+// NewImplementationWrapper loads the plugin in dir. mode governs how strict
+// the dependency-version check against the host's own build is, for any
+// dependency the plugin manifest doesn't already cover with its own
+// DependencyPolicy. trustedKeys are the host's own Ed25519 public keys;
+// an object's signature must verify against one of them, since the
+// manifest sitting next to the objects cannot itself be trusted to name
+// the right key.
+func NewImplementationWrapper(dir string, mode CompatibilityMode, trustedKeys []ed25519.PublicKey) (*ImplementationWrapper, error) {
+	gen, err := loadGeneration(dir, mode, trustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImplementationWrapper{}
+	result.current.Store(gen)
+
+	return result, nil
+}
+
+// loadGeneration globs the objects directory, verifies the plugin manifest
+// and signatures, dynamically links the objects, and resolves the
+// entrypoint, returning a fresh generation ready to be stored or swapped in.
+func loadGeneration(dir string, mode CompatibilityMode, trustedKeys []ed25519.PublicKey) (*generation, error) {
 	archivesPattern := filepath.Join(dir, "/*.a")
 	globbedArchives, err := filepath.Glob(archivesPattern)
 	if err != nil {
@@ -68,7 +169,16 @@ func NewImplementationWrapper(dir string) (*ImplementationWrapper, error) {
 
 	allObjects := append(globbedArchives, globbedObjects...)
 
-	err = checkDependencies(allObjects)
+	manifest, err := loadPluginManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin manifest: %w", err)
+	}
+
+	if err = verifyObjectSignatures(manifest, allObjects, trustedKeys); err != nil {
+		return nil, fmt.Errorf("failed to verify plugin signatures: %w", err)
+	}
+
+	err = checkDependencies(allObjects, manifest.DependencyPolicies, mode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check dependencies: %w", err)
 	}
@@ -78,6 +188,12 @@ func NewImplementationWrapper(dir string) (*ImplementationWrapper, error) {
 		return nil, fmt.Errorf("go object loader could not register symbol table: %w", err)
 	}
 
+	// make host-provided callbacks (logging, metrics, config, ...) resolvable
+	// by plugins before we dynamically link against symPtr
+	for name, ptr := range registeredHostSymbols() {
+		symPtr[name] = ptr
+	}
+
 	linker, err := goloader.ReadObjs(allObjects, make([]string, len(allObjects)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read objects: %w", err)
@@ -88,38 +204,88 @@ func NewImplementationWrapper(dir string) (*ImplementationWrapper, error) {
 		return nil, fmt.Errorf("failed to dynamically link objects: %w", err)
 	}
 
-	// we expect the constructor function to be present in the main package
-	ctorPtr, err := getFncPtr(module, "main.NewImplementation")
+	// the entrypoint symbol name comes from the manifest instead of being a
+	// hardcoded convention, and is resolved through the same typed registry
+	// lookup a caller would use for any other plugin-exported symbol
+	ctor, err := lookupTyped[func() Interface](module, manifest.Entrypoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get implementation constructor fn: %w", err)
 	}
 
-	// unsafe-land!
-	// this case relies on the signature of the constructor to be the same
-	// for all the implementations
-	ctor := *(*func() Interface)(ctorPtr)
-
-	result := &ImplementationWrapper{
+	gen := &generation{
 		module:         module,
 		implementation: ctor(),
 	}
+	gen.unload = gen.module.Unload
 
-	return result, nil
+	return gen, nil
 }
 
 func (iw *ImplementationWrapper) ProcessStuff(stuff string) (string, error) {
-	// implement the Interface to use the wrapper where we want it
-	if iw.module == nil {
-		return "", errors.New("no implementation loaded")
+	gen, err := iw.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer iw.release(gen)
+
+	return gen.implementation.ProcessStuff(stuff)
+}
+
+// acquire increments the refcount of the currently active generation and
+// returns it. Incrementing first and only then re-checking iw.current
+// against what we loaded is what closes the race with retire: if a swap
+// happened in between, retire may already have observed refCount==0 and
+// unloaded gen before we ever got to increment, so we must not trust an
+// increment taken after a bare Load. Re-validating after the increment
+// catches that case and retries against whatever is current instead.
+func (iw *ImplementationWrapper) acquire() (*generation, error) {
+	for {
+		gen := iw.current.Load()
+		if gen == nil {
+			return nil, errors.New("no implementation loaded")
+		}
+
+		atomic.AddInt64(&gen.refCount, 1)
+		if iw.current.Load() == gen {
+			return gen, nil
+		}
+
+		// gen was swapped out between the load and the increment: our
+		// increment may have raced retire's zero-check, so undo it and
+		// retry against whatever generation is active now.
+		iw.release(gen)
+	}
+}
+
+// release drops gen's refcount and unloads it if it has already been
+// retired and this was the last in-flight call.
+func (iw *ImplementationWrapper) release(gen *generation) {
+	if atomic.AddInt64(&gen.refCount, -1) == 0 && atomic.LoadInt32(&gen.retiring) == 1 {
+		gen.unloadOnce()
+	}
+}
+
+// retire marks gen as no longer the active generation and unloads it
+// immediately if nothing is using it, deferring to release otherwise.
+func (iw *ImplementationWrapper) retire(gen *generation) {
+	atomic.StoreInt32(&gen.retiring, 1)
+	if atomic.LoadInt64(&gen.refCount) == 0 {
+		gen.unloadOnce()
+	}
+}
+
+// swapGeneration atomically installs newGen as the active generation and
+// retires whichever generation was active before it.
+func (iw *ImplementationWrapper) swapGeneration(newGen *generation) {
+	old := iw.current.Swap(newGen)
+	if old != nil {
+		iw.retire(old)
 	}
-	return iw.implementation.ProcessStuff(stuff)
 }
 
 func (iw *ImplementationWrapper) UnloadImplementation() {
-	if iw.module != nil {
-		iw.implementation = nil
-		iw.module.Unload()
-		iw.module = nil
+	if gen := iw.current.Swap(nil); gen != nil {
+		iw.retire(gen)
 	}
 }
 
@@ -132,7 +298,7 @@ func getFncPtr(module *goloader.CodeModule, fncName string) (unsafe.Pointer, err
 	return unsafe.Pointer(&ptrTofPtr), nil
 }
 
-func checkDependencies(objects []string) error {
+func checkDependencies(objects []string, policies []DependencyPolicy, mode CompatibilityMode) error {
 	// read own build info
 	buildInfo, err := getBuildInfo()
 	if err != nil {
@@ -151,10 +317,9 @@ func checkDependencies(objects []string) error {
 	if implementationBuildInfo != nil {
 		// We need to make sure that what we load has the same deps as we are running with.
 		// If a dependency is missing the loader will already fail during dynamic linking,
-		// so what is left to us is to check the versions.
-		// The question is how strict we want to be? So for now we don't return an error
-		// from validateDependencies but only log some warnings
-		if err = validateDependencies(buildInfo, implementationBuildInfo); err != nil {
+		// so what is left to us is to check the versions, honoring the per-dep policy
+		// overrides declared in the plugin manifest.
+		if err = validateDependencies(buildInfo, implementationBuildInfo, policies, mode); err != nil {
 			return err
 		}
 	}
@@ -191,6 +356,13 @@ func getModInfoFromFile(path string) *debug.BuildInfo {
 }
 
 // keep in sync with src/runtime/debug/mod.go:readBuildInfo
+//
+// Handles both the pre-1.18 layout (path/mod/dep/=> lines only) and the
+// current one, which adds a standalone "go\t<version>" line carrying
+// GoVersion and "build\t" lines carrying the GOOS/GOARCH/-compiler/...
+// BuildSettings after the dependency list. The two share a line-oriented
+// format, so there is nothing to branch on: a legacy blob simply has no
+// go/build lines to parse.
 func readBuildInfo(data string) (*debug.BuildInfo, bool) {
 	if len(data) < 32 {
 		return nil, false
@@ -198,10 +370,12 @@ func readBuildInfo(data string) (*debug.BuildInfo, bool) {
 	data = data[16 : len(data)-16]
 
 	const (
-		pathLine = "path\t"
-		modLine  = "mod\t"
-		depLine  = "dep\t"
-		repLine  = "=>\t"
+		goLine    = "go\t"
+		pathLine  = "path\t"
+		modLine   = "mod\t"
+		depLine   = "dep\t"
+		repLine   = "=>\t"
+		buildLine = "build\t"
 	)
 
 	readEntryFirstLine := func(elem []string) (debug.Module, bool) {
@@ -233,6 +407,8 @@ func readBuildInfo(data string) (*debug.BuildInfo, bool) {
 		}
 		line, data = data[:i], data[i+1:]
 		switch {
+		case strings.HasPrefix(line, goLine):
+			info.GoVersion = line[len(goLine):]
 		case strings.HasPrefix(line, pathLine):
 			elem := line[len(pathLine):]
 			info.Path = elem
@@ -265,36 +441,171 @@ func readBuildInfo(data string) (*debug.BuildInfo, bool) {
 				Sum:     elem[2],
 			}
 			last = nil
+		case strings.HasPrefix(line, buildLine):
+			key, value, found := strings.Cut(line[len(buildLine):], "=")
+			if !found {
+				key, value = line[len(buildLine):], ""
+			}
+			if strings.HasPrefix(value, `"`) {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+			}
+			info.Settings = append(info.Settings, debug.BuildSetting{Key: key, Value: value})
 		}
 	}
 	return info, true
 }
 
-func validateDependencies(buildInfo, needed *debug.BuildInfo) error {
-	having := make(map[string]*debug.Module)
+// buildSetting returns the value of the named BuildSetting from info, if
+// present.
+func buildSetting(info *debug.BuildInfo, key string) (string, bool) {
+	for _, setting := range info.Settings {
+		if setting.Key == key {
+			return setting.Value, true
+		}
+	}
+	return "", false
+}
 
-	for _, dep := range buildInfo.Deps {
-		having[dep.Path] = dep
-		// is a single level enough?
-		if dep.Replace != nil {
-			having[dep.Path] = dep.Replace
+// validateABICompatibility refuses to load a plugin whose GOOS, GOARCH,
+// compiler, or Go toolchain minor version differ from the host's in a way
+// that would make the dynamically linked code ABI-incompatible.
+func validateABICompatibility(host, plugin *debug.BuildInfo) error {
+	if hostValue, ok := buildSetting(host, "GOARCH"); ok {
+		if pluginValue, ok := buildSetting(plugin, "GOARCH"); ok && pluginValue != hostValue {
+			return fmt.Errorf("refusing to load plugin built for GOARCH=%s on host GOARCH=%s", pluginValue, hostValue)
 		}
 	}
 
+	if hostValue, ok := buildSetting(host, "GOOS"); ok {
+		if pluginValue, ok := buildSetting(plugin, "GOOS"); ok && pluginValue != hostValue {
+			return fmt.Errorf("refusing to load plugin built for GOOS=%s on host GOOS=%s", pluginValue, hostValue)
+		}
+	}
+
+	if hostValue, ok := buildSetting(host, "-compiler"); ok {
+		if pluginValue, ok := buildSetting(plugin, "-compiler"); ok && pluginValue != hostValue {
+			return fmt.Errorf("refusing to load plugin built with compiler %s on host compiler %s", pluginValue, hostValue)
+		}
+	}
+
+	if host.GoVersion != "" && plugin.GoVersion != "" && goVersionNewerMinor(plugin.GoVersion, host.GoVersion) {
+		return fmt.Errorf("refusing to load plugin built with newer Go toolchain %s than host %s", plugin.GoVersion, host.GoVersion)
+	}
+
+	return nil
+}
+
+// goVersionNewerMinor reports whether candidate (e.g. "go1.22.1") is a newer
+// major or minor release than baseline. Unparsable versions are treated as
+// compatible, matching this package's existing fail-open stance on build
+// info it cannot make sense of.
+func goVersionNewerMinor(candidate, baseline string) bool {
+	candidateMajor, candidateMinor, ok := parseGoVersion(candidate)
+	if !ok {
+		return false
+	}
+	baselineMajor, baselineMinor, ok := parseGoVersion(baseline)
+	if !ok {
+		return false
+	}
+	if candidateMajor != baselineMajor {
+		return candidateMajor > baselineMajor
+	}
+	return candidateMinor > baselineMinor
+}
+
+func parseGoVersion(version string) (major, minor int, ok bool) {
+	version = strings.TrimPrefix(version, "go")
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// parts[1] may carry a pre-release suffix straight after the minor
+	// digits, e.g. "22rc1" for go1.22rc1: take the leading digit run
+	// instead of trimming trailing non-digits, which a trailing digit in
+	// the suffix itself would defeat.
+	minorDigits := parts[1]
+	if end := strings.IndexFunc(minorDigits, func(r rune) bool {
+		return r < '0' || r > '9'
+	}); end >= 0 {
+		minorDigits = minorDigits[:end]
+	}
+
+	minor, err = strconv.Atoi(minorDigits)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
+
+// resolveModule returns the module dep actually selects: itself, or its
+// replacement if one is declared. Applying this to both the host's and the
+// plugin's dependency lists is what makes replace handling symmetric.
+func resolveModule(dep *debug.Module) *debug.Module {
+	if dep.Replace != nil {
+		return dep.Replace
+	}
+	return dep
+}
+
+func validateDependencies(buildInfo, needed *debug.BuildInfo, policies []DependencyPolicy, defaultMode CompatibilityMode) error {
+	if err := validateABICompatibility(buildInfo, needed); err != nil {
+		return err
+	}
+
+	having := make(map[string]*debug.Module)
+	for _, dep := range buildInfo.Deps {
+		having[dep.Path] = resolveModule(dep)
+	}
+
+	var mismatches []DependencyMismatch
 	for _, dep := range needed.Deps {
 		have, found := having[dep.Path]
 		if !found {
 			// we should never reach this due to the dynamic linking
 			return fmt.Errorf("missing dependency: %s", dep.Path)
 		}
-		if have.Version != dep.Version {
-			// for now, we just print a warning
+
+		want := resolveModule(dep)
+		if have.Version == want.Version {
+			continue
+		}
+
+		mode := defaultMode
+		if policyMode, matched := matchDependencyPolicy(policies, dep.Path); matched {
+			mode = policyMode.compatibilityMode()
+		}
+
+		if mode == WarnOnly {
 			fmt.Printf(
 				"version mismatch while validating dynamically loaded obj %s@%s: dep %s mismatch have=%s want=%s\n",
 				needed.Main.Path, needed.Main.Version,
-				dep.Path, have.Version, dep.Version,
+				dep.Path, have.Version, want.Version,
 			)
+			continue
 		}
+
+		if err := checkVersionCompatibility(have.Version, want.Version, mode); err != nil {
+			mismatches = append(mismatches, DependencyMismatch{
+				Path:   dep.Path,
+				Have:   have.Version,
+				Want:   want.Version,
+				Reason: err.Error(),
+			})
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &DependencyMismatchError{Mismatches: mismatches}
 	}
 	return nil
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// sentinelPad mimics the 16 bytes of sentinel framing readBuildInfo strips
+// from each end; the test only cares about the line-oriented text readBuildInfo
+// parses, not the actual sentinel hex values.
+const sentinelPad = "0123456789abcdef"
+
+func TestReadBuildInfoRoundTrip(t *testing.T) {
+	want := &debug.BuildInfo{
+		GoVersion: "go1.22.1",
+		Path:      "example.com/plugin",
+		Main: debug.Module{
+			Path:    "example.com/plugin",
+			Version: "v1.2.3",
+			Sum:     "h1:abc=",
+		},
+		Deps: []*debug.Module{
+			{Path: "example.com/dep", Version: "v0.1.0", Sum: "h1:def="},
+			{
+				Path:    "example.com/replaced",
+				Version: "v1.0.0",
+				Sum:     "h1:ghi=",
+				Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.1", Sum: "h1:jkl="},
+			},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "GOOS", Value: "linux"},
+			{Key: "GOARCH", Value: "amd64"},
+			{Key: "-compiler", Value: "gc"},
+		},
+	}
+
+	data := sentinelPad + want.String() + sentinelPad
+
+	got, ok := readBuildInfo(data)
+	if !ok {
+		t.Fatalf("readBuildInfo() returned ok=false for:\n%s", want.String())
+	}
+
+	if got.GoVersion != want.GoVersion {
+		t.Errorf("GoVersion = %q, want %q", got.GoVersion, want.GoVersion)
+	}
+	if got.Path != want.Path {
+		t.Errorf("Path = %q, want %q", got.Path, want.Path)
+	}
+	if got.Main != want.Main {
+		t.Errorf("Main = %+v, want %+v", got.Main, want.Main)
+	}
+	if len(got.Deps) != len(want.Deps) {
+		t.Fatalf("len(Deps) = %d, want %d", len(got.Deps), len(want.Deps))
+	}
+	for i, dep := range want.Deps {
+		if got.Deps[i].Path != dep.Path || got.Deps[i].Version != dep.Version {
+			t.Errorf("Deps[%d] = %+v, want %+v", i, got.Deps[i], dep)
+		}
+		if dep.Replace != nil {
+			if got.Deps[i].Replace == nil || *got.Deps[i].Replace != *dep.Replace {
+				t.Errorf("Deps[%d].Replace = %+v, want %+v", i, got.Deps[i].Replace, dep.Replace)
+			}
+		}
+	}
+	for _, setting := range want.Settings {
+		value, ok := buildSetting(got, setting.Key)
+		if !ok || value != setting.Value {
+			t.Errorf("buildSetting(%q) = (%q, %v), want (%q, true)", setting.Key, value, ok, setting.Value)
+		}
+	}
+}
+
+func TestReadBuildInfoLegacyFormat(t *testing.T) {
+	// pre-1.18 blobs never had go/build lines at all.
+	legacy := "path\texample.com/plugin\n" +
+		"mod\texample.com/plugin\tv1.0.0\th1:abc=\n" +
+		"dep\texample.com/dep\tv0.1.0\th1:def=\n"
+	data := sentinelPad + legacy + sentinelPad
+
+	info, ok := readBuildInfo(data)
+	if !ok {
+		t.Fatalf("readBuildInfo() returned ok=false for legacy blob")
+	}
+	if info.GoVersion != "" {
+		t.Errorf("GoVersion = %q, want empty for a legacy blob", info.GoVersion)
+	}
+	if len(info.Settings) != 0 {
+		t.Errorf("Settings = %+v, want none for a legacy blob", info.Settings)
+	}
+	if info.Main.Version != "v1.0.0" {
+		t.Errorf("Main.Version = %q, want v1.0.0", info.Main.Version)
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	tests := []struct {
+		version    string
+		wantMajor  int
+		wantMinor  int
+		wantParsed bool
+	}{
+		{"go1.21.3", 1, 21, true},
+		{"go1.22", 1, 22, true},
+		{"go1.22rc1", 1, 22, true},
+		{"1.22", 1, 22, true},
+		{"garbage", 0, 0, false},
+		{"go1", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		major, minor, ok := parseGoVersion(tt.version)
+		if ok != tt.wantParsed {
+			t.Errorf("parseGoVersion(%q) ok = %v, want %v", tt.version, ok, tt.wantParsed)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if major != tt.wantMajor || minor != tt.wantMinor {
+			t.Errorf("parseGoVersion(%q) = (%d, %d), want (%d, %d)", tt.version, major, minor, tt.wantMajor, tt.wantMinor)
+		}
+	}
+}
+
+func TestGoVersionNewerMinor(t *testing.T) {
+	tests := []struct {
+		candidate string
+		baseline  string
+		want      bool
+	}{
+		{"go1.22.0", "go1.21.5", true},
+		{"go1.21.5", "go1.22.0", false},
+		{"go1.21.5", "go1.21.0", false},
+		{"go2.0.0", "go1.22.0", true},
+		{"garbage", "go1.22.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := goVersionNewerMinor(tt.candidate, tt.baseline); got != tt.want {
+			t.Errorf("goVersionNewerMinor(%q, %q) = %v, want %v", tt.candidate, tt.baseline, got, tt.want)
+		}
+	}
+}
+
+func TestValidateABICompatibilityRefusesArchMismatch(t *testing.T) {
+	host := &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "GOARCH", Value: "amd64"}}}
+	plugin := &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "GOARCH", Value: "arm64"}}}
+
+	err := validateABICompatibility(host, plugin)
+	if err == nil {
+		t.Fatal("expected an error for mismatched GOARCH, got nil")
+	}
+	if !strings.Contains(err.Error(), "GOARCH") {
+		t.Errorf("error %q does not mention GOARCH", err)
+	}
+}
+
+// newTestGeneration returns a generation whose unload is a counter instead
+// of a real module.Unload, so the acquire/release/retire state machine can
+// be exercised without a dynamically-linked goloader.CodeModule behind it.
+func newTestGeneration() (*generation, *int32) {
+	var unloadCalls int32
+	gen := &generation{
+		unload: func() { atomic.AddInt32(&unloadCalls, 1) },
+	}
+	return gen, &unloadCalls
+}
+
+func TestAcquireNoImplementationLoaded(t *testing.T) {
+	iw := &ImplementationWrapper{}
+	if _, err := iw.acquire(); err == nil {
+		t.Fatal("acquire() on an empty wrapper should return an error")
+	}
+}
+
+func TestRetireDefersUnloadToLastRelease(t *testing.T) {
+	gen, unloadCalls := newTestGeneration()
+	iw := &ImplementationWrapper{}
+	iw.current.Store(gen)
+
+	acquired, err := iw.acquire()
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if acquired != gen {
+		t.Fatal("acquire() returned a different generation than the one stored")
+	}
+
+	iw.retire(gen)
+	if got := atomic.LoadInt32(unloadCalls); got != 0 {
+		t.Fatalf("retire() unloaded a generation with an in-flight caller, calls=%d", got)
+	}
+
+	iw.release(gen)
+	if got := atomic.LoadInt32(unloadCalls); got != 1 {
+		t.Fatalf("release() should unload a retired generation once its last caller drops off, calls=%d", got)
+	}
+}
+
+func TestRetireUnloadsImmediatelyWithNoInFlightCallers(t *testing.T) {
+	gen, unloadCalls := newTestGeneration()
+	iw := &ImplementationWrapper{}
+
+	iw.retire(gen)
+	if got := atomic.LoadInt32(unloadCalls); got != 1 {
+		t.Fatalf("retire() with refCount==0 should unload immediately, calls=%d", got)
+	}
+}
+
+// TestReleaseNeverDoubleUnloadsAfterRetireWon reproduces the exact window
+// acquire() leaves open between reading iw.current and incrementing
+// refCount: retire already saw refCount==0 and unloaded, and acquire's
+// increment (plus its own release of the stale generation) must not unload
+// it a second time.
+func TestReleaseNeverDoubleUnloadsAfterRetireWon(t *testing.T) {
+	gen, unloadCalls := newTestGeneration()
+	iw := &ImplementationWrapper{}
+	iw.current.Store(gen)
+
+	// A concurrent swap+retire runs to completion before our increment.
+	iw.current.Store(&generation{unload: func() {}})
+	iw.retire(gen)
+	if got := atomic.LoadInt32(unloadCalls); got != 1 {
+		t.Fatalf("retire() should have unloaded gen once, calls=%d", got)
+	}
+
+	// acquire()'s increment lands after the fact; it notices the swap and
+	// releases gen instead of returning it.
+	atomic.AddInt64(&gen.refCount, 1)
+	iw.release(gen)
+	if got := atomic.LoadInt32(unloadCalls); got != 1 {
+		t.Fatalf("release() double-unloaded gen, calls=%d, want 1", got)
+	}
+}
+
+// TestAcquireReleaseRetireConcurrentNeverDoubleUnloads hammers acquire and
+// release from several goroutines while generations are repeatedly swapped
+// and retired out from under them, the same shape of contention
+// PluginSupervisor's hot-reload creates against in-flight ProcessStuff
+// calls. It asserts the total number of unloads across all generations
+// equals the number of generations retired.
+func TestAcquireReleaseRetireConcurrentNeverDoubleUnloads(t *testing.T) {
+	var unloadCalls int32
+	newGen := func() *generation {
+		return &generation{unload: func() { atomic.AddInt32(&unloadCalls, 1) }}
+	}
+
+	iw := &ImplementationWrapper{}
+	iw.current.Store(newGen())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				gen, err := iw.acquire()
+				if err != nil {
+					continue
+				}
+				iw.release(gen)
+			}
+		}()
+	}
+
+	const swaps = 200
+	for i := 0; i < swaps; i++ {
+		iw.swapGeneration(newGen())
+	}
+	close(stop)
+	wg.Wait()
+	iw.UnloadImplementation()
+
+	if got, want := atomic.LoadInt32(&unloadCalls), int32(swaps+1); got != want {
+		t.Fatalf("unload calls = %d, want exactly %d (one per retired generation, never more)", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestFileName is the name of the plugin manifest expected alongside the
+// .a/.o files in the objects directory.
+const manifestFileName = "plugin.json"
+
+// CurrentInterfaceVersion is the Interface version this host implements.
+// A plugin manifest declaring any other value is refused at load time.
+const CurrentInterfaceVersion = 1
+
+// trustedKeysEnvVar names the environment variable holding the host's
+// trusted Ed25519 signing keys (base64, comma-separated) used to verify
+// plugin objects. Kept out of any file the objects directory itself could
+// influence.
+const trustedKeysEnvVar = "PLUGIN_TRUSTED_KEYS"
+
+// trustedKeysFromEnv reads and decodes the host's trusted signing keys from
+// trustedKeysEnvVar.
+func trustedKeysFromEnv() ([]ed25519.PublicKey, error) {
+	raw := strings.TrimSpace(os.Getenv(trustedKeysEnvVar))
+	if raw == "" {
+		return nil, nil
+	}
+
+	var keys []ed25519.PublicKey
+	for _, encoded := range strings.Split(raw, ",") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s entry: %w", trustedKeysEnvVar, err)
+		}
+		if len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s entry has invalid length %d", trustedKeysEnvVar, len(decoded))
+		}
+		keys = append(keys, ed25519.PublicKey(decoded))
+	}
+
+	return keys, nil
+}
+
+// DependencyPolicyMode controls how strictly a dependency's version is
+// checked against the host's own build, for dependencies matched by a
+// DependencyPolicy glob.
+type DependencyPolicyMode string
+
+const (
+	// DependencyPolicyStrictEqual requires the host and plugin to share the
+	// exact same version for the matched dependency.
+	DependencyPolicyStrictEqual DependencyPolicyMode = "strict-equal"
+	// DependencyPolicySemverCompatible allows any host version that is
+	// semver-compatible with the one the plugin was built against.
+	DependencyPolicySemverCompatible DependencyPolicyMode = "semver-compatible"
+	// DependencyPolicyWarnOnly preserves the historical behaviour: mismatches
+	// are logged but never block loading.
+	DependencyPolicyWarnOnly DependencyPolicyMode = "warn-only"
+)
+
+// DependencyPolicy pairs a glob over module paths (matched with
+// filepath.Match) with the policy mode to apply to any dependency whose path
+// matches it. Policies are evaluated in order and the first match wins.
+type DependencyPolicy struct {
+	ModulePathGlob string               `json:"modulePathGlob"`
+	Mode           DependencyPolicyMode `json:"mode"`
+}
+
+// ObjectSignature is the detached Ed25519 signature for a single object or
+// archive file listed in the manifest, keyed by the file's base name.
+type ObjectSignature struct {
+	File      string `json:"file"`
+	Signature string `json:"signature"` // base64-encoded
+}
+
+// PluginManifest describes a plugin in terms the wrapper needs before it will
+// dynamically link anything: the entrypoint to call, the interface version it
+// was built against, per-object signatures, and the dependency drift policy.
+//
+// It deliberately does not carry the public key objects are verified
+// against: the manifest sits in the same untrusted objects directory as the
+// files it describes, so a key declared here would let an attacker who can
+// write to that directory sign their own tampered objects and pass
+// verification. The trusted key(s) must instead come from the host via
+// NewImplementationWrapper.
+type PluginManifest struct {
+	Entrypoint         string             `json:"entrypoint"`
+	InterfaceVersion   int                `json:"interfaceVersion"`
+	Signatures         []ObjectSignature  `json:"signatures"`
+	DependencyPolicies []DependencyPolicy `json:"dependencyPolicies"`
+}
+
+// loadPluginManifest reads and parses the plugin manifest from dir.
+func loadPluginManifest(dir string) (*PluginManifest, error) {
+	path := filepath.Join(dir, manifestFileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin manifest %s: %w", path, err)
+	}
+
+	var manifest PluginManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin manifest %s: %w", path, err)
+	}
+
+	if manifest.Entrypoint == "" {
+		return nil, fmt.Errorf("plugin manifest %s does not declare an entrypoint", path)
+	}
+
+	if manifest.InterfaceVersion != CurrentInterfaceVersion {
+		return nil, fmt.Errorf(
+			"plugin manifest %s declares interface version %d, host requires %d",
+			path, manifest.InterfaceVersion, CurrentInterfaceVersion,
+		)
+	}
+
+	return &manifest, nil
+}
+
+// verifyObjectSignatures checks that every object file has a matching
+// Ed25519 signature in the manifest that verifies against at least one of
+// trustedKeys, refusing to proceed if any object is unsigned or its
+// signature doesn't verify against any trusted key. trustedKeys must come
+// from the host's own configuration, never from the manifest itself, or
+// this check verifies nothing: an attacker able to write to the objects
+// directory could otherwise ship their own key alongside their own
+// signatures.
+func verifyObjectSignatures(manifest *PluginManifest, objects []string, trustedKeys []ed25519.PublicKey) error {
+	if len(trustedKeys) == 0 {
+		return errors.New("no trusted signing keys configured; refusing to load plugin")
+	}
+
+	signatures := make(map[string]string, len(manifest.Signatures))
+	for _, sig := range manifest.Signatures {
+		signatures[sig.File] = sig.Signature
+	}
+
+	for _, obj := range objects {
+		name := filepath.Base(obj)
+
+		encodedSig, found := signatures[name]
+		if !found {
+			return fmt.Errorf("refusing to load unsigned object: %s", name)
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(encodedSig)
+		if err != nil {
+			return fmt.Errorf("failed to decode signature for %s: %w", name, err)
+		}
+
+		data, err := ioutil.ReadFile(obj)
+		if err != nil {
+			return fmt.Errorf("failed to read object for signature verification: %w", err)
+		}
+
+		verified := false
+		for _, trustedKey := range trustedKeys {
+			if ed25519.Verify(trustedKey, data, sig) {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			return fmt.Errorf("refusing to load tampered object: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// matchDependencyPolicy returns the mode of the first policy whose glob
+// matches modulePath. The bool reports whether a manifest policy matched at
+// all, so the caller can fall back to its own default CompatibilityMode
+// instead of assuming warn-only.
+func matchDependencyPolicy(policies []DependencyPolicy, modulePath string) (DependencyPolicyMode, bool) {
+	for _, policy := range policies {
+		matched, err := filepath.Match(policy.ModulePathGlob, modulePath)
+		if err == nil && matched {
+			return policy.Mode, true
+		}
+	}
+	return "", false
+}
+
+// compatibilityMode maps a manifest-declared DependencyPolicyMode onto the
+// CompatibilityMode the version-compatibility check understands.
+func (m DependencyPolicyMode) compatibilityMode() CompatibilityMode {
+	switch m {
+	case DependencyPolicyStrictEqual:
+		return Strict
+	case DependencyPolicySemverCompatible:
+		return SameMajor
+	default:
+		return WarnOnly
+	}
+}
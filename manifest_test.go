@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestMatchDependencyPolicy(t *testing.T) {
+	policies := []DependencyPolicy{
+		{ModulePathGlob: "example.com/internal/*", Mode: DependencyPolicyStrictEqual},
+		{ModulePathGlob: "example.com/*", Mode: DependencyPolicySemverCompatible},
+	}
+
+	tests := []struct {
+		modulePath string
+		wantMode   DependencyPolicyMode
+		wantMatch  bool
+	}{
+		{"example.com/internal/auth", DependencyPolicyStrictEqual, true},
+		{"example.com/public", DependencyPolicySemverCompatible, true},
+		{"other.org/lib", "", false},
+	}
+
+	for _, tt := range tests {
+		mode, matched := matchDependencyPolicy(policies, tt.modulePath)
+		if matched != tt.wantMatch {
+			t.Errorf("matchDependencyPolicy(%q) matched = %v, want %v", tt.modulePath, matched, tt.wantMatch)
+			continue
+		}
+		if matched && mode != tt.wantMode {
+			t.Errorf("matchDependencyPolicy(%q) mode = %q, want %q", tt.modulePath, mode, tt.wantMode)
+		}
+	}
+}
+
+func TestDependencyPolicyModeCompatibilityMode(t *testing.T) {
+	tests := []struct {
+		policyMode DependencyPolicyMode
+		want       CompatibilityMode
+	}{
+		{DependencyPolicyStrictEqual, Strict},
+		{DependencyPolicySemverCompatible, SameMajor},
+		{DependencyPolicyWarnOnly, WarnOnly},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policyMode.compatibilityMode(); got != tt.want {
+			t.Errorf("%q.compatibilityMode() = %v, want %v", tt.policyMode, got, tt.want)
+		}
+	}
+}
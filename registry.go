@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/pkujhd/goloader"
+)
+
+// typeDescriptorSuffix is appended to a symbol name to find its optional
+// type descriptor: an exported `func() string` returning reflect.Type's
+// String() for the symbol, which is the only type metadata goloader's
+// output gives us access to. A symbol without one is looked up unverified.
+const typeDescriptorSuffix = ".Type"
+
+var hostSymbols = struct {
+	mu      sync.Mutex
+	symbols map[string]uintptr
+}{symbols: map[string]uintptr{}}
+
+// RegisterHostSymbol exposes a host-provided function to plugins under name,
+// so it is resolved through symPtr and linked in before goloader.Load runs.
+// This lets plugins call back into host-provided logging, metrics, or
+// config instead of only being called into.
+func RegisterHostSymbol(name string, fn any) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		panic(fmt.Sprintf("RegisterHostSymbol: %s is not a function", name))
+	}
+
+	hostSymbols.mu.Lock()
+	defer hostSymbols.mu.Unlock()
+	hostSymbols.symbols[name] = value.Pointer()
+}
+
+// registeredHostSymbols returns a copy of the symbols registered so far,
+// ready to be merged into a generation's symPtr table.
+func registeredHostSymbols() map[string]uintptr {
+	hostSymbols.mu.Lock()
+	defer hostSymbols.mu.Unlock()
+
+	symbols := make(map[string]uintptr, len(hostSymbols.symbols))
+	for name, ptr := range hostSymbols.symbols {
+		symbols[name] = ptr
+	}
+	return symbols
+}
+
+// Lookup resolves an arbitrary exported symbol from iw's active generation
+// and returns it as T. Go doesn't allow a type parameter on a method, so
+// this is a free function taking the wrapper rather than wrapper.Lookup[T].
+//
+// The returned value is not pinned once Lookup returns: resolving it pins
+// the generation it came from against a concurrent hot-reload the same way
+// ProcessStuff does, but the pin is released before Lookup returns, so
+// nothing keeps that generation loaded afterwards. Do not store the result and call it later
+// or from another goroutine — a reload in between can unload the module it
+// points into, which is the same use-after-Unload crash PluginSupervisor
+// exists to prevent for ProcessStuff.
+func Lookup[T any](iw *ImplementationWrapper, name string) (T, error) {
+	var zero T
+
+	gen, err := iw.acquire()
+	if err != nil {
+		return zero, err
+	}
+	defer iw.release(gen)
+
+	return lookupTyped[T](gen.module, name)
+}
+
+// lookupTyped resolves name from module and verifies it against T's
+// reflect.Type before returning it, refusing the lookup on a declared
+// mismatch.
+func lookupTyped[T any](module *goloader.CodeModule, name string) (T, error) {
+	var zero T
+
+	if err := verifySymbolType[T](module, name); err != nil {
+		return zero, fmt.Errorf("failed to verify type of symbol %s: %w", name, err)
+	}
+
+	ptr, err := getFncPtr(module, name)
+	if err != nil {
+		return zero, fmt.Errorf("failed to look up symbol %s: %w", name, err)
+	}
+
+	return *(*T)(ptr), nil
+}
+
+// verifySymbolType compares T's reflect.Type against the symbol's optional
+// type descriptor. A symbol with no descriptor is allowed through
+// unverified, since not every plugin built against an older SDK will emit
+// one.
+func verifySymbolType[T any](module *goloader.CodeModule, name string) error {
+	descriptorPtr, err := getFncPtr(module, name+typeDescriptorSuffix)
+	if err != nil {
+		return nil
+	}
+
+	describe := *(*func() string)(descriptorPtr)
+	want := reflect.TypeOf((*T)(nil)).Elem().String()
+	if got := describe(); got != want {
+		return fmt.Errorf("type mismatch: module declares %s, caller wants %s", got, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkujhd/goloader"
+)
+
+// healthCheckSymbol is the exported function a newly loaded module must
+// provide so the supervisor can confirm it is safe to receive traffic
+// before the previous generation is retired.
+const healthCheckSymbol = "main.HealthCheck"
+
+// reloadDebounce coalesces bursts of filesystem events (linkers and editors
+// tend to write several files back to back) into a single reload attempt.
+const reloadDebounce = 200 * time.Millisecond
+
+// PluginSupervisor watches a plugin's objects directory and hot-reloads the
+// wrapped ImplementationWrapper whenever a new set of .a/.o files appears,
+// without ever dropping an in-flight ProcessStuff call on the floor.
+type PluginSupervisor struct {
+	dir         string
+	mode        CompatibilityMode
+	trustedKeys []ed25519.PublicKey
+	wrapper     *ImplementationWrapper
+	watcher     *fsnotify.Watcher
+	done        chan struct{}
+}
+
+// NewPluginSupervisor loads the plugin currently in dir and starts watching
+// it for hot-reloads. mode and trustedKeys are forwarded to every load,
+// including reloads.
+func NewPluginSupervisor(dir string, mode CompatibilityMode, trustedKeys []ed25519.PublicKey) (*PluginSupervisor, error) {
+	wrapper, err := NewImplementationWrapper(dir, mode, trustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin directory watcher: %w", err)
+	}
+
+	if err = watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch plugin directory: %w", err)
+	}
+
+	supervisor := &PluginSupervisor{
+		dir:         dir,
+		mode:        mode,
+		trustedKeys: trustedKeys,
+		wrapper:     wrapper,
+		watcher:     watcher,
+		done:        make(chan struct{}),
+	}
+	go supervisor.watch()
+
+	return supervisor, nil
+}
+
+// Wrapper returns the live ImplementationWrapper. Its ProcessStuff always
+// targets whichever generation is currently active, regardless of reloads
+// happening concurrently.
+func (s *PluginSupervisor) Wrapper() *ImplementationWrapper {
+	return s.wrapper
+}
+
+// Close stops watching the objects directory and unloads the active
+// generation.
+func (s *PluginSupervisor) Close() {
+	close(s.done)
+	s.watcher.Close()
+	s.wrapper.UnloadImplementation()
+}
+
+func (s *PluginSupervisor) watch() {
+	var reloadTimer *time.Timer
+	reload := make(chan struct{}, 1)
+
+	for {
+		select {
+		case <-s.done:
+			if reloadTimer != nil {
+				reloadTimer.Stop()
+			}
+			return
+
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if !isObjectFile(event.Name) {
+				continue
+			}
+			if reloadTimer != nil {
+				reloadTimer.Stop()
+			}
+			reloadTimer = time.AfterFunc(reloadDebounce, func() {
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			})
+
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("plugin directory watcher error: %s\n", err)
+
+		case <-reload:
+			if err := s.reload(); err != nil {
+				fmt.Printf("failed to hot-reload plugin: %s\n", err)
+			}
+		}
+	}
+}
+
+func isObjectFile(name string) bool {
+	return strings.HasSuffix(name, ".a") || strings.HasSuffix(name, ".o")
+}
+
+// reload loads the objects currently present in the directory into a new
+// generation, warms it up via the health-check symbol, and atomically swaps
+// it in. The previous generation is only retired, not unloaded outright: any
+// ProcessStuff call already in flight on it is left to finish first.
+func (s *PluginSupervisor) reload() error {
+	newGen, err := loadGeneration(s.dir, s.mode, s.trustedKeys)
+	if err != nil {
+		return err
+	}
+
+	if err = warmUp(newGen.module); err != nil {
+		newGen.module.Unload()
+		return fmt.Errorf("new plugin generation failed health check: %w", err)
+	}
+
+	s.wrapper.swapGeneration(newGen)
+	return nil
+}
+
+// warmUp calls the plugin's exported health-check symbol and fails the
+// reload if it is missing or returns an error.
+func warmUp(module *goloader.CodeModule) error {
+	healthCheck, err := lookupTyped[func() error](module, healthCheckSymbol)
+	if err != nil {
+		return fmt.Errorf("missing health-check symbol %s: %w", healthCheckSymbol, err)
+	}
+
+	return healthCheck()
+}